@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/stellar/go/txnbuild"
+)
+
+const MAX_OPS_PER_TX = 100
+
+// batchRow is one CSV line queued into the transaction currently being
+// assembled, kept around so flushBatch can record it in the batch manifest
+// once the transaction's hash is known.
+type batchRow struct {
+	index  int
+	target string
+	amount string
+	memo   string
+}
+
+// batchManifestWriter records which CSV rows landed in which transaction
+// hash, so auditors can reconstruct the mapping from --ops-per-tx batching.
+type batchManifestWriter struct {
+	f *os.File
+}
+
+func newBatchManifestWriter(path string) (*batchManifestWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString("row_index,target,amount,memo,tx_hash\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &batchManifestWriter{f: f}, nil
+}
+
+func (w *batchManifestWriter) WriteBatch(rows []batchRow, txHash string) error {
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(w.f, "%d,%s,%s,%s,%s\n", row.index, row.target, row.amount, row.memo, txHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *batchManifestWriter) Close() error {
+	return w.f.Close()
+}
+
+// batchMemoHash derives a single MemoHash for a batch of payouts as the
+// Merkle root of each payout's own memo hash, so any signer can
+// independently reproduce and verify the same batches from the same CSV.
+// With a single-row batch (the default --ops-per-tx=1) the root is just
+// that row's memo, preserving the tool's previous behavior exactly.
+func batchMemoHash(memos []string) (txnbuild.MemoHash, error) {
+	leaves := make([][32]byte, len(memos))
+	for i, memo := range memos {
+		raw, err := hex.DecodeString(memo)
+		if err != nil {
+			return txnbuild.MemoHash{}, fmt.Errorf("memo %s is not valid hex: %w", memo, err)
+		}
+		var leaf [32]byte
+		copy(leaf[:], raw)
+		leaves[i] = leaf
+	}
+
+	return txnbuild.MemoHash(merkleRoot(leaves)), nil
+}
+
+func merkleRoot(leaves [][32]byte) [32]byte {
+	level := leaves
+	for len(level) > 1 {
+		next := make([][32]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			combined := append(append([]byte{}, level[i][:]...), level[i+1][:]...)
+			next = append(next, sha256.Sum256(combined))
+		}
+		level = next
+	}
+	if len(level) == 0 {
+		return [32]byte{}
+	}
+	return level[0]
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+func runCombine(args []string) {
+	fs := flag.NewFlagSet("combine", flag.ExitOnError)
+	var signerFiles stringSliceFlag
+	fs.Var(&signerFiles, "signerfile", "A per-signer file produced by 'signingfile sign'. Repeat this flag once per signer")
+	outputFile := fs.String("outputfile", "payouts_signed_combined.txt", "The output file containing the fully-signed transactions")
+	minWeight := fs.Int("min_weight", 0, "Override the required signer weight instead of using the account's medium threshold from Horizon")
+	fs.Parse(args)
+
+	if len(signerFiles) < 2 {
+		panic("At least two --signerfile flags are required to combine signatures")
+	}
+
+	perSignerLines := make([][]string, len(signerFiles))
+	for i, path := range signerFiles {
+		lines, err := readLines(path)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to read signer file %s: %s", path, err))
+		}
+		perSignerLines[i] = lines
+	}
+
+	txCount := len(perSignerLines[0])
+	for i, lines := range perSignerLines {
+		if len(lines) != txCount {
+			panic(fmt.Sprintf("Signer file %s has %d transactions, expected %d", signerFiles[i], len(lines), txCount))
+		}
+	}
+
+	cl := horizonclient.DefaultPublicNetClient
+
+	acc, err := cl.AccountDetail(horizonclient.AccountRequest{AccountID: TFT_ISSUER})
+	if err != nil {
+		panic(fmt.Sprintf("Failed to fetch source account thresholds %s", err))
+	}
+	threshold := int(acc.Thresholds.MedThreshold)
+	if *minWeight != 0 {
+		threshold = *minWeight
+	}
+	weightOf := make(map[string]int32, len(acc.Signers))
+	for _, signer := range acc.Signers {
+		weightOf[signer.Key] = int32(signer.Weight)
+	}
+
+	out, err := os.Create(*outputFile)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to open output file %s", err))
+	}
+	defer out.Close()
+	defer out.Sync()
+
+	for i := 0; i < txCount; i++ {
+		merged, innerSignatures, err := mergeSignatures(perSignerLines, i)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to merge signatures for transaction %d: %s", i, err))
+		}
+
+		if err := checkSignatureWeight(innerSignatures, weightOf, int32(threshold)); err != nil {
+			panic(fmt.Sprintf("Transaction %d does not meet signer threshold: %s", i, err))
+		}
+
+		xdrStr, err := merged.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+		out.WriteString(string(xdrStr))
+		out.WriteString("\n")
+	}
+
+	fmt.Println("Combined", txCount, "transactions from", len(signerFiles), "signers")
+}
+
+// marshalableTransaction is satisfied by both txnbuild.Transaction and
+// txnbuild.FeeBumpTransaction, letting combine handle fee-bump-wrapped
+// payments without a separate code path per envelope kind.
+type marshalableTransaction interface {
+	MarshalText() ([]byte, error)
+}
+
+// mergeSignatures reconstructs transaction i by taking the union of the
+// decorated signatures found across every signer's variant of its inner
+// payment transaction, deduped by hint and signature bytes. It returns the
+// merged envelope (re-wrapped in its fee-bump, if any) plus the inner
+// signature set used to check the multisig threshold.
+func mergeSignatures(perSignerLines [][]string, i int) (marshalableTransaction, []xdr.DecoratedSignature, error) {
+	var base *txnbuild.Transaction
+	var feeBumpTemplate *txnbuild.FeeBumpTransaction
+	seen := make(map[string]bool)
+	var merged []xdr.DecoratedSignature
+	// missing holds the merged signatures that base does not carry yet.
+	var missing []xdr.DecoratedSignature
+
+	for _, lines := range perSignerLines {
+		genericTx, err := txnbuild.TransactionFromXDR(lines[i])
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse transaction envelope")
+		}
+
+		tx, ok := genericTx.Transaction()
+		if !ok {
+			feeBump, ok := genericTx.FeeBump()
+			if !ok {
+				return nil, nil, errors.New("unrecognized transaction envelope")
+			}
+			feeBumpTemplate = feeBump
+			tx = feeBump.InnerTransaction()
+		}
+		isBase := base == nil
+		if isBase {
+			base = tx
+		}
+
+		for _, sig := range tx.Signatures() {
+			key := string(sig.Hint[:]) + string(sig.Signature)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, sig)
+			if !isBase {
+				missing = append(missing, sig)
+			}
+		}
+	}
+
+	for _, sig := range missing {
+		var err error
+		base, err = base.AddSignatureDecorated(sig)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to attach signature")
+		}
+	}
+
+	if feeBumpTemplate == nil {
+		return base, merged, nil
+	}
+
+	rebuilt, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      base,
+		FeeAccount: feeBumpTemplate.FeeAccount(),
+		BaseFee:    feeBumpTemplate.BaseFee(),
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to rebuild fee-bump transaction")
+	}
+	for _, sig := range feeBumpTemplate.Signatures() {
+		rebuilt, err = rebuilt.AddSignatureDecorated(sig)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to reattach fee-bump signature")
+		}
+	}
+
+	return rebuilt, merged, nil
+}
+
+func checkSignatureWeight(signatures []xdr.DecoratedSignature, weightOf map[string]int32, threshold int32) error {
+	var total int32
+	for _, sig := range signatures {
+		for signer, weight := range weightOf {
+			kp, err := keypairFromAddress(signer)
+			if err != nil {
+				continue
+			}
+			if kp.Hint() == sig.Hint {
+				total += weight
+				break
+			}
+		}
+	}
+
+	if total < threshold {
+		return errors.Errorf("accumulated signer weight %d is below required threshold %d", total, threshold)
+	}
+	return nil
+}
+
+func keypairFromAddress(address string) (*keypair.FromAddress, error) {
+	return keypair.ParseAddress(address)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+	return lines, nil
+}
+
+// stringSliceFlag collects repeated occurrences of a flag into a slice.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
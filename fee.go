@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+)
+
+// FEE_BUMP_SEED_ENV is the environment variable checked for the fee-bump
+// source's secret seed when --fee-bump-signer is not provided, mirroring
+// SIGNER_SEED_ENV for the payment signers.
+const FEE_BUMP_SEED_ENV = "FEE_BUMP_SEED"
+
+// selectBaseFee picks a dynamic base fee from the network's recent fee
+// stats instead of the old hard-coded BASE_FEE, so the cold multisig
+// account doesn't need to keep a fixed XLM buffer just to overpay during
+// quiet periods. It uses the p90 of recent max_fee bids, clamped to
+// maxFee when maxFee is positive.
+func selectBaseFee(cl *horizonclient.Client, maxFee int64) (int64, error) {
+	stats, err := cl.FeeStats()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch fee stats: %w", err)
+	}
+
+	fee := stats.MaxFee.P90
+
+	if fee < txnbuild.MinBaseFee {
+		fee = txnbuild.MinBaseFee
+	}
+	if maxFee > 0 && fee > maxFee {
+		fee = maxFee
+	}
+
+	return fee, nil
+}
+
+// wrapFeeBump wraps tx in a fee-bump transaction paid for by source, so the
+// cold multisig account's own balance never has to cover fees. When
+// signerSeed is non-empty the fee-bump envelope is signed immediately,
+// since the fee source is a single account rather than part of the
+// payment's multisig set.
+func wrapFeeBump(tx *txnbuild.Transaction, source, signerSeed string, baseFee int64) (*txnbuild.FeeBumpTransaction, error) {
+	feeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      tx,
+		FeeAccount: source,
+		BaseFee:    baseFee,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build fee-bump transaction: %w", err)
+	}
+
+	if signerSeed == "" {
+		return feeBump, nil
+	}
+
+	kp, err := keypair.ParseFull(signerSeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fee-bump signer seed: %w", err)
+	}
+
+	signed, err := feeBump.Sign(network.PublicNetworkPassphrase, kp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign fee-bump transaction: %w", err)
+	}
+
+	return signed, nil
+}
+
+// signInnerTransaction adds kp's signature to the inner payment transaction
+// of a fee-bump envelope, leaving the fee account's own signature on the
+// outer envelope untouched.
+func signInnerTransaction(feeBump *txnbuild.FeeBumpTransaction, kp *keypair.Full) (*txnbuild.FeeBumpTransaction, error) {
+	inner := feeBump.InnerTransaction()
+
+	signedInner, err := inner.Sign(network.PublicNetworkPassphrase, kp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign inner transaction: %w", err)
+	}
+
+	rebuilt, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      signedInner,
+		FeeAccount: feeBump.FeeAccount(),
+		BaseFee:    feeBump.BaseFee(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild fee-bump transaction: %w", err)
+	}
+
+	for _, sig := range feeBump.Signatures() {
+		rebuilt, err = rebuilt.AddSignatureDecorated(sig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reattach fee-bump signature: %w", err)
+		}
+	}
+
+	return rebuilt, nil
+}
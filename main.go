@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"encoding/base64"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -13,7 +12,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/stellar/go/clients/horizonclient"
-	"github.com/stellar/go/protocols/horizon/operations"
+	"github.com/stellar/go/network"
 	"github.com/stellar/go/txnbuild"
 )
 
@@ -24,15 +23,33 @@ const (
 	TRANSACTIONS_PER_PAGE = 100
 	HORIZON_PAGE_LIMIT    = 200
 
-	BASE_FEE                  = 1_000_000 // 0.1XLM
 	TXN_VALIDITY_TIME_SECONDS = 60 * 60 * 24 * 6
 )
 
 var (
-	sequenceNumber int64
-	payoutFile     string
-	outputFile     string
-	checkTrust     bool
+	sequenceNumber  int64
+	payoutFile      string
+	outputFile      string
+	checkTrust      bool
+	memoHistory     string
+	memoCacheFile   string
+	memoHubbleDump  string
+	maxFee          int64
+	feeBumpSource   string
+	feeBumpSigner   string
+	minSeqAge       int64
+	minSeqLedgerGap int64
+	ledgerBoundsMin int64
+	ledgerBoundsMax int64
+	minSeqNumber    int64
+	extraSigners    stringSliceFlag
+
+	claimableBalancePredicate string
+	pathPaymentSourceAsset    string
+	pathPaymentSlippageBps    int64
+
+	opsPerTx          int
+	batchManifestFile string
 )
 
 func init() {
@@ -40,9 +57,44 @@ func init() {
 	flag.StringVar(&payoutFile, "payoutsfile", "payout_info.csv", "The input csv file")
 	flag.StringVar(&outputFile, "outputfile", "payouts_to_sign.txt", "The output file to send around")
 	flag.BoolVar(&checkTrust, "check_trust", true, "whether trustlines should be checked for destinations")
+	flag.StringVar(&memoHistory, "memo-history", "horizon", "Where to source already-used memos from: horizon, cache or hubble")
+	flag.StringVar(&memoCacheFile, "memo-cache-file", "memo_history.db", "BoltDB file used by the cache and hubble memo history backends")
+	flag.StringVar(&memoHubbleDump, "memo-hubble-dump", "", "Path to a downloaded ledger dump, required when --memo-history=hubble")
+	flag.Int64Var(&maxFee, "max-fee", 0, "Clamp the dynamically selected base fee to this value in stroops. 0 means no clamp")
+	flag.StringVar(&feeBumpSource, "fee-bump-source", "", "Account that pays fees for the generated transactions via a fee-bump wrapper. Empty disables fee-bump wrapping")
+	flag.StringVar(&feeBumpSigner, "fee-bump-signer", "", "Path to a file with the fee-bump source's secret seed. If empty, FEE_BUMP_SEED is used instead")
+	flag.Int64Var(&minSeqAge, "min-seq-age", 0, "CAP-21: minimum number of seconds the source account's sequence must have been unchanged for")
+	flag.Int64Var(&minSeqLedgerGap, "min-seq-ledger-gap", 0, "CAP-21: minimum number of ledgers since the source account's sequence last changed")
+	flag.Int64Var(&ledgerBoundsMin, "ledger-bounds-min", 0, "CAP-21: minimum ledger the transaction is valid in. 0 means unset")
+	flag.Int64Var(&ledgerBoundsMax, "ledger-bounds-max", 0, "CAP-21: maximum ledger the transaction is valid in. 0 means unset")
+	flag.Int64Var(&minSeqNumber, "min-seq-number", 0, "CAP-21: minimum sequence number the source account must be at. 0 uses the account's current sequence")
+	flag.Var(&extraSigners, "extra-signer", "CAP-21: an additional signer (G... address) required on top of the account's normal signer set. Repeatable")
+	flag.StringVar(&claimableBalancePredicate, "claimable-balance-predicate", CLAIMABLE_BALANCE_PREDICATE_UNCONDITIONAL, "Predicate for claimable-balance payouts: unconditional or expiry (30-day expiry back to the issuer)")
+	flag.StringVar(&pathPaymentSourceAsset, "path-payment-source", "native", "Source asset for path-payment payouts: native, or CODE:ISSUER")
+	flag.Int64Var(&pathPaymentSlippageBps, "path-payment-slippage-bps", 50, "Basis points of slippage to pad onto the quoted SendMax for path-payment payouts, to absorb price movement during multisig signature collection")
+	flag.IntVar(&opsPerTx, "ops-per-tx", 1, "Number of CSV rows to bundle into a single transaction, up to 100")
+	flag.StringVar(&batchManifestFile, "batch-manifest", "payouts_batch_manifest.csv", "Output file mapping CSV rows to the transaction hash they were batched into")
 }
 
+// main with no subcommand keeps the original behavior of generating unsigned
+// XDR from a payouts CSV. "sign" and "combine" turn that output into a real
+// M-of-N multisig workflow for accounts like the TFT issuer, and "submit"
+// takes the fully-signed result and posts it to Horizon.
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "sign":
+			runSign(os.Args[2:])
+			return
+		case "combine":
+			runCombine(os.Args[2:])
+			return
+		case "submit":
+			runSubmit(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 
 	if sequenceNumber == 0 {
@@ -51,11 +103,12 @@ func main() {
 
 	cl := horizonclient.DefaultPublicNetClient
 
-	knownMemos, err := getMemoHashes(cl, TFT_ISSUER)
+	history, err := newMemoHistory(cl, memoHistory, memoCacheFile, memoHubbleDump)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to list known memos %s", err))
+		panic(fmt.Sprintf("Failed to set up memo history %s", err))
 	}
-	fmt.Println("Got a list of all memos")
+	defer history.Close()
+	fmt.Println("Memo history ready")
 
 	payoutFile, err := os.Open(payoutFile)
 	if err != nil {
@@ -78,147 +131,180 @@ func main() {
 		trustlineVerifier = NOPChecker{}
 	}
 
-	for {
-		line, err := reader.ReadString('\n')
+	baseFee, err := selectBaseFee(cl, maxFee)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to select a base fee %s", err))
+	}
+	fmt.Println("Using base fee of", baseFee, "stroops")
+
+	var feeBumpSignerSeed string
+	if feeBumpSource != "" {
+		feeBumpSignerSeed, err = loadSeed(feeBumpSigner, FEE_BUMP_SEED_ENV)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			panic(err)
-		}
-		if line == "" {
-			break
+			panic(fmt.Sprintf("Failed to load fee-bump signer seed %s", err))
 		}
+	}
 
-		parts := strings.Split(strings.TrimSpace(line), ",")
-		if len(parts) != 3 {
-			panic("Invalid file layout")
-		}
+	preconditions, err := buildPreconditions()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to build preconditions %s", err))
+	}
 
-		target := strings.TrimSpace(parts[0])
-		amount := strings.TrimSpace(parts[1])
-		memo := strings.TrimSpace(parts[2])
+	if opsPerTx < 1 || opsPerTx > MAX_OPS_PER_TX {
+		panic(fmt.Sprintf("--ops-per-tx must be between 1 and %d", MAX_OPS_PER_TX))
+	}
 
-		for _, knownMemo := range knownMemos {
-			if knownMemo == memo {
-				fmt.Println("ERROR: Payment of", amount, "TFT to", target, "with memo", memo, "already happened")
-				continue
-			}
-		}
+	manifest, err := newBatchManifestWriter(batchManifestFile)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to open batch manifest file %s", err))
+	}
+	defer manifest.Close()
 
-		hasTrustline, err := trustlineVerifier.TrustLineCheck(target)
-		if err != nil {
-			panic(fmt.Sprintf("Could not check trustline %s", err))
-		}
+	var pendingOps []txnbuild.Operation
+	var pendingMemos []string
+	var pendingRows []batchRow
 
-		if !hasTrustline {
-			fmt.Println("ERROR:", target, "has no trusltine for TFT")
-			continue
+	flushBatch := func() {
+		if len(pendingOps) == 0 {
+			return
 		}
 
-		memoBytes, err := hex.DecodeString(memo)
+		memoHash, err := batchMemoHash(pendingMemos)
 		if err != nil {
-			panic(fmt.Sprintf("Memo %s is not valid hex", memo))
+			panic(fmt.Sprintf("Failed to derive batch memo %s", err))
 		}
-		memoHash := txnbuild.MemoHash{}
-		copy(memoHash[:], memoBytes)
-
-		fmt.Println("Sending", amount, "to", target, "with memo", memo)
 
-		paymentOp := txnbuild.Payment{
-			Destination:   target,
-			Amount:        amount,
-			Asset:         txnbuild.CreditAsset{Code: TFT_ASSET_CODE, Issuer: TFT_ISSUER},
-			SourceAccount: TFT_ISSUER,
+		// The on-chain memo for this transaction is the batch's Merkle
+		// root, not any individual row's memo, so the already-paid check
+		// against memo history has to be redone against that root here.
+		// Without this, a re-run of the same CSV with the same
+		// --ops-per-tx would never recognize a previously submitted batch
+		// and would happily re-pay every row in it.
+		batchMemoHex := hex.EncodeToString(memoHash[:])
+		alreadyPaid, err := history.HasMemo(batchMemoHex)
+		if err != nil {
+			panic(fmt.Sprintf("Could not check memo history for batch %s", err))
 		}
-
-		if err = paymentOp.Validate(); err != nil {
-			fmt.Println("ERROR: Could not construct payment to", target, err)
-			continue
+		if alreadyPaid {
+			fmt.Println("ERROR: Batch with memo", batchMemoHex, "covering", len(pendingRows), "rows already happened")
+			pendingOps, pendingMemos, pendingRows = nil, nil, nil
+			return
 		}
 
 		params := txnbuild.TransactionParams{
 			SourceAccount:        &txnbuild.SimpleAccount{AccountID: TFT_ISSUER, Sequence: sequenceNumber},
 			IncrementSequenceNum: true,
-			Operations:           []txnbuild.Operation{&paymentOp},
-			BaseFee:              BASE_FEE,
+			Operations:           pendingOps,
+			BaseFee:              baseFee,
 			Memo:                 memoHash,
-			Preconditions: txnbuild.Preconditions{
-				TimeBounds: txnbuild.NewTimeout(TXN_VALIDITY_TIME_SECONDS),
-			},
+			Preconditions:        preconditions,
 		}
 
 		tx, err := txnbuild.NewTransaction(params)
 		if err != nil {
-			fmt.Println("ERROR: Failed to generate minting transaction", err)
+			fmt.Println("ERROR: Failed to generate minting transaction for", len(pendingRows), "rows, dropping the batch:", err)
+			pendingOps, pendingMemos, pendingRows = nil, nil, nil
+			return
 		}
 
 		sequenceNumber = tx.SequenceNumber()
 
-		xdr, err := tx.MarshalText()
+		var envelope marshalableTransaction = tx
+		if feeBumpSource != "" {
+			envelope, err = wrapFeeBump(tx, feeBumpSource, feeBumpSignerSeed, baseFee)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to wrap transaction in a fee bump %s", err))
+			}
+		}
+
+		xdr, err := envelope.MarshalText()
 		if err != nil {
 			panic(err)
 		}
 		outFile.WriteString(string(xdr))
 		outFile.WriteString("\n")
-	}
 
-}
-
-func getMemoHashes(cl *horizonclient.Client, account string) ([]string, error) {
-	cursor := ""
+		txHash, err := tx.HashHex(network.PublicNetworkPassphrase)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to compute transaction hash %s", err))
+		}
+		if err := manifest.WriteBatch(pendingRows, txHash); err != nil {
+			panic(fmt.Sprintf("Failed to write batch manifest %s", err))
+		}
 
-	memos := []string{}
+		pendingOps, pendingMemos, pendingRows = nil, nil, nil
+	}
 
+	rowIndex := 0
 	for {
-		opReq := horizonclient.OperationRequest{
-			ForAccount: account,
-			Cursor:     cursor,
-			Limit:      HORIZON_PAGE_LIMIT,
-			Join:       "transactions",
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			panic(err)
+		}
+		if line == "" {
+			break
+		}
+
+		parts := strings.Split(strings.TrimSpace(line), ",")
+		if len(parts) != 3 && len(parts) != 4 {
+			panic("Invalid file layout")
+		}
+
+		target := strings.TrimSpace(parts[0])
+		amount := strings.TrimSpace(parts[1])
+		memo := strings.TrimSpace(parts[2])
+		mode := PAYOUT_MODE_PAYMENT
+		if len(parts) == 4 {
+			mode = strings.TrimSpace(parts[3])
 		}
-		ops, err := cl.Operations(opReq)
+		rowIndex++
+
+		alreadyPaid, err := history.HasMemo(memo)
 		if err != nil {
-			e := err.(*horizonclient.Error)
-			if e.Response.StatusCode == 500 {
-				time.Sleep(time.Second)
+			panic(fmt.Sprintf("Could not check memo history %s", err))
+		}
+		if alreadyPaid {
+			fmt.Println("ERROR: Payment of", amount, "TFT to", target, "with memo", memo, "already happened")
+			continue
+		}
+
+		if mode == PAYOUT_MODE_PAYMENT {
+			hasTrustline, err := trustlineVerifier.TrustLineCheck(target)
+			if err != nil {
+				panic(fmt.Sprintf("Could not check trustline %s", err))
+			}
+
+			if !hasTrustline {
+				fmt.Println("ERROR:", target, "has no trusltine for TFT")
 				continue
 			}
-			fmt.Println(e.Problem)
-			return nil, err
 		}
 
-		if len(ops.Embedded.Records) == 0 {
-			break
+		if _, err := hex.DecodeString(memo); err != nil {
+			panic(fmt.Sprintf("Memo %s is not valid hex", memo))
 		}
 
-		cursor = ops.Embedded.Records[len(ops.Embedded.Records)-1].PagingToken()
-		for _, op := range ops.Embedded.Records {
-			if payment, ok := op.(operations.Payment); ok {
-				if payment.From != account {
-					continue
-				}
-				memo := ""
-				if payment.Transaction != nil {
-					if payment.Transaction.MemoType != "hash" {
-						// All minting txes have a "hash" memo type
-						continue
-					}
-					raw, err := base64.StdEncoding.DecodeString(payment.Transaction.Memo)
-					if err != nil {
-						return nil, err
-					}
-					memo = hex.EncodeToString(raw)
-					memos = append(memos, memo)
-				}
-			}
+		fmt.Println("Sending", amount, "to", target, "with memo", memo, "via", mode)
+
+		payoutOp, err := buildPayoutOp(cl, target, amount, mode)
+		if err != nil {
+			fmt.Println("ERROR: Could not construct payout to", target, err)
+			continue
 		}
-		if len(ops.Embedded.Records) < 200 {
-			break
+
+		pendingOps = append(pendingOps, payoutOp)
+		pendingMemos = append(pendingMemos, memo)
+		pendingRows = append(pendingRows, batchRow{index: rowIndex, target: target, amount: amount, memo: memo})
+
+		if len(pendingOps) == opsPerTx {
+			flushBatch()
 		}
 	}
 
-	return memos, nil
+	flushBatch()
 }
 
 type TFTTrustLineChecker interface {
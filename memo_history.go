@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/clients/horizonclient"
+)
+
+// MemoHistory answers whether a hex-encoded memo hash has already been used
+// for a payout from the issuer account. Implementations may be backed
+// directly by Horizon, by a local cache that incrementally syncs from
+// Horizon, or by a bulk import of a ledger dump.
+type MemoHistory interface {
+	HasMemo(memo string) (bool, error)
+	Close() error
+}
+
+// newMemoHistory builds the MemoHistory backend selected by --memo-history.
+// "horizon" reproduces the original behavior of scanning every historical
+// operation on every run. "cache" additionally persists a local BoltDB store
+// keyed by the last synced paging cursor, so only operations since the
+// previous run need to be fetched. "hubble" bulk-loads a downloaded ledger
+// dump into that same store instead of paging Horizon at all.
+func newMemoHistory(cl *horizonclient.Client, backend, cacheFile, hubbleDump string) (MemoHistory, error) {
+	switch backend {
+	case "", "horizon":
+		return newHorizonMemoHistory(cl, TFT_ISSUER)
+	case "cache":
+		return newCachedMemoHistory(cl, TFT_ISSUER, cacheFile)
+	case "hubble":
+		if hubbleDump == "" {
+			return nil, fmt.Errorf("--memo-hubble-dump is required when --memo-history=hubble")
+		}
+		return newHubbleMemoHistory(cacheFile, hubbleDump)
+	default:
+		return nil, fmt.Errorf("unknown memo history backend %q", backend)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon/operations"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	memoBucket = []byte("memos")
+	metaBucket = []byte("meta")
+	cursorKey  = []byte("cursor")
+)
+
+// cachedMemoHistory backs HasMemo with a BoltDB file that is synced
+// incrementally: each run only fetches operations since the paging cursor
+// saved from the previous run, instead of rescanning the issuer's entire
+// history.
+type cachedMemoHistory struct {
+	db *bolt.DB
+}
+
+func newCachedMemoHistory(cl *horizonclient.Client, account, cacheFile string) (*cachedMemoHistory, error) {
+	if cacheFile == "" {
+		cacheFile = "memo_history.db"
+	}
+
+	db, err := bolt.Open(cacheFile, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open memo cache %s: %w", cacheFile, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(memoBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &cachedMemoHistory{db: db}
+	if err := h.sync(cl, account); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *cachedMemoHistory) sync(cl *horizonclient.Client, account string) error {
+	cursor, err := h.loadCursor()
+	if err != nil {
+		return err
+	}
+
+	for {
+		opReq := horizonclient.OperationRequest{
+			ForAccount: account,
+			Cursor:     cursor,
+			Limit:      HORIZON_PAGE_LIMIT,
+			Join:       "transactions",
+		}
+		ops, err := cl.Operations(opReq)
+		if err != nil {
+			e, ok := err.(*horizonclient.Error)
+			if ok && e.Response.StatusCode == 500 {
+				time.Sleep(time.Second)
+				continue
+			}
+			return err
+		}
+
+		if len(ops.Embedded.Records) == 0 {
+			break
+		}
+
+		newMemos := make([]string, 0, len(ops.Embedded.Records))
+		for _, op := range ops.Embedded.Records {
+			if payment, ok := op.(operations.Payment); ok {
+				if payment.From != account || payment.Transaction == nil {
+					continue
+				}
+				if payment.Transaction.MemoType != "hash" {
+					continue
+				}
+				raw, err := base64.StdEncoding.DecodeString(payment.Transaction.Memo)
+				if err != nil {
+					return err
+				}
+				newMemos = append(newMemos, hex.EncodeToString(raw))
+			}
+		}
+
+		cursor = ops.Embedded.Records[len(ops.Embedded.Records)-1].PagingToken()
+		if err := h.saveProgress(cursor, newMemos); err != nil {
+			return err
+		}
+
+		if len(ops.Embedded.Records) < HORIZON_PAGE_LIMIT {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (h *cachedMemoHistory) loadCursor() (string, error) {
+	var cursor string
+	err := h.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(metaBucket).Get(cursorKey); v != nil {
+			cursor = string(v)
+		}
+		return nil
+	})
+	return cursor, err
+}
+
+func (h *cachedMemoHistory) saveProgress(cursor string, memos []string) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		mb := tx.Bucket(memoBucket)
+		for _, memo := range memos {
+			if err := mb.Put([]byte(memo), []byte{1}); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Put(cursorKey, []byte(cursor))
+	})
+}
+
+func (h *cachedMemoHistory) HasMemo(memo string) (bool, error) {
+	found := false
+	err := h.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(memoBucket).Get([]byte(memo)) != nil
+		return nil
+	})
+	return found, err
+}
+
+func (h *cachedMemoHistory) Close() error {
+	return h.db.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon/operations"
+)
+
+// horizonMemoHistory reproduces the tool's original behavior: on
+// construction it pages through every historical payment operation from
+// account and keeps the resulting memos in memory.
+type horizonMemoHistory struct {
+	memos map[string]bool
+}
+
+func newHorizonMemoHistory(cl *horizonclient.Client, account string) (*horizonMemoHistory, error) {
+	cursor := ""
+	memos := make(map[string]bool)
+
+	for {
+		opReq := horizonclient.OperationRequest{
+			ForAccount: account,
+			Cursor:     cursor,
+			Limit:      HORIZON_PAGE_LIMIT,
+			Join:       "transactions",
+		}
+		ops, err := cl.Operations(opReq)
+		if err != nil {
+			e := err.(*horizonclient.Error)
+			if e.Response.StatusCode == 500 {
+				time.Sleep(time.Second)
+				continue
+			}
+			fmt.Println(e.Problem)
+			return nil, err
+		}
+
+		if len(ops.Embedded.Records) == 0 {
+			break
+		}
+
+		cursor = ops.Embedded.Records[len(ops.Embedded.Records)-1].PagingToken()
+		for _, op := range ops.Embedded.Records {
+			if payment, ok := op.(operations.Payment); ok {
+				if payment.From != account {
+					continue
+				}
+				if payment.Transaction != nil {
+					if payment.Transaction.MemoType != "hash" {
+						// All minting txes have a "hash" memo type
+						continue
+					}
+					raw, err := base64.StdEncoding.DecodeString(payment.Transaction.Memo)
+					if err != nil {
+						return nil, err
+					}
+					memos[hex.EncodeToString(raw)] = true
+				}
+			}
+		}
+		if len(ops.Embedded.Records) < HORIZON_PAGE_LIMIT {
+			break
+		}
+	}
+
+	return &horizonMemoHistory{memos: memos}, nil
+}
+
+func (h *horizonMemoHistory) HasMemo(memo string) (bool, error) {
+	return h.memos[memo], nil
+}
+
+func (h *horizonMemoHistory) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// hubbleRecord is one line of a downloaded Stellar Hubble / BigQuery
+// `history_operations` export: a flattened payment operation, newline
+// delimited JSON. Like Horizon's own operations.Payment.Transaction.Memo,
+// the memo field is base64-encoded raw memo bytes.
+type hubbleRecord struct {
+	From     string `json:"source_account"`
+	MemoType string `json:"memo_type"`
+	Memo     string `json:"memo"`
+}
+
+// hubbleMemoHistory bulk-loads a ledger dump into a BoltDB store instead of
+// paging Horizon operation-by-operation, which is the only practical way to
+// backfill years of issuer history.
+type hubbleMemoHistory struct {
+	db *bolt.DB
+}
+
+func newHubbleMemoHistory(cacheFile, dumpPath string) (*hubbleMemoHistory, error) {
+	if cacheFile == "" {
+		cacheFile = "memo_history.db"
+	}
+
+	db, err := bolt.Open(cacheFile, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open memo cache %s: %w", cacheFile, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(memoBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &hubbleMemoHistory{db: db}
+	if err := h.importDump(dumpPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *hubbleMemoHistory) importDump(dumpPath string) error {
+	f, err := os.Open(dumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger dump %s: %w", dumpPath, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	imported := 0
+	return h.db.Update(func(tx *bolt.Tx) error {
+		mb := tx.Bucket(memoBucket)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var rec hubbleRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return fmt.Errorf("failed to parse ledger dump line: %w", err)
+			}
+			if rec.From != TFT_ISSUER || rec.MemoType != "hash" || rec.Memo == "" {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(rec.Memo)
+			if err != nil {
+				return fmt.Errorf("memo %q is not valid base64: %w", rec.Memo, err)
+			}
+			if err := mb.Put([]byte(hex.EncodeToString(raw)), []byte{1}); err != nil {
+				return err
+			}
+			imported++
+		}
+		fmt.Println("Imported", imported, "memos from ledger dump")
+		return scanner.Err()
+	})
+}
+
+func (h *hubbleMemoHistory) HasMemo(memo string) (bool, error) {
+	found := false
+	err := h.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(memoBucket).Get([]byte(memo)) != nil
+		return nil
+	})
+	return found, err
+}
+
+func (h *hubbleMemoHistory) Close() error {
+	return h.db.Close()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/txnbuild"
+)
+
+const (
+	PAYOUT_MODE_PAYMENT           = "payment"
+	PAYOUT_MODE_CLAIMABLE_BALANCE = "claimable_balance"
+	PAYOUT_MODE_PATH_PAYMENT      = "path_payment"
+
+	CLAIMABLE_BALANCE_PREDICATE_UNCONDITIONAL = "unconditional"
+	CLAIMABLE_BALANCE_PREDICATE_EXPIRY        = "expiry"
+	CLAIMABLE_BALANCE_EXPIRY_DAYS             = 30
+)
+
+// buildPayoutOp builds the operation for a single payout row according to
+// mode, which comes from the optional 4th CSV column and defaults to a
+// plain payment. claimable_balance is used for destinations without a TFT
+// trustline, and path_payment lets destinations holding only
+// --path-payment-source receive a TFT-denominated payout.
+func buildPayoutOp(cl *horizonclient.Client, target, amount, mode string) (txnbuild.Operation, error) {
+	switch mode {
+	case "", PAYOUT_MODE_PAYMENT:
+		return &txnbuild.Payment{
+			Destination:   target,
+			Amount:        amount,
+			Asset:         txnbuild.CreditAsset{Code: TFT_ASSET_CODE, Issuer: TFT_ISSUER},
+			SourceAccount: TFT_ISSUER,
+		}, nil
+	case PAYOUT_MODE_CLAIMABLE_BALANCE:
+		return buildClaimableBalanceOp(target, amount)
+	case PAYOUT_MODE_PATH_PAYMENT:
+		return buildPathPaymentOp(cl, target, amount)
+	default:
+		return nil, fmt.Errorf("unknown payout mode %q", mode)
+	}
+}
+
+// buildClaimableBalanceOp creates a claimable balance claimable by target,
+// used as a fallback for destinations without a TFT trustline. The
+// predicate is controlled by --claimable-balance-predicate: either
+// unconditional, or an expiry after which the issuer can reclaim the funds.
+func buildClaimableBalanceOp(target, amount string) (txnbuild.Operation, error) {
+	unconditional := txnbuild.UnconditionalPredicate
+	claimants := []txnbuild.Claimant{txnbuild.NewClaimant(target, &unconditional)}
+
+	switch claimableBalancePredicate {
+	case "", CLAIMABLE_BALANCE_PREDICATE_UNCONDITIONAL:
+		// destination-only, unconditional claimant above is enough
+	case CLAIMABLE_BALANCE_PREDICATE_EXPIRY:
+		deadline := time.Now().AddDate(0, 0, CLAIMABLE_BALANCE_EXPIRY_DAYS)
+		beforeDeadline := txnbuild.BeforeAbsoluteTimePredicate(deadline.Unix())
+		afterDeadline := txnbuild.NotPredicate(beforeDeadline)
+
+		claimants = []txnbuild.Claimant{
+			txnbuild.NewClaimant(target, &beforeDeadline),
+			txnbuild.NewClaimant(TFT_ISSUER, &afterDeadline),
+		}
+	default:
+		return nil, fmt.Errorf("unknown --claimable-balance-predicate %q", claimableBalancePredicate)
+	}
+
+	return &txnbuild.CreateClaimableBalance{
+		Destinations:  claimants,
+		Asset:         txnbuild.CreditAsset{Code: TFT_ASSET_CODE, Issuer: TFT_ISSUER},
+		Amount:        amount,
+		SourceAccount: TFT_ISSUER,
+	}, nil
+}
+
+// buildPathPaymentOp lets a destination holding only --path-payment-source
+// (XLM by default) receive a TFT-denominated payout, by auto-discovering a
+// strict-receive path from that asset to TFT via Horizon.
+func buildPathPaymentOp(cl *horizonclient.Client, target, amount string) (txnbuild.Operation, error) {
+	destAsset := txnbuild.CreditAsset{Code: TFT_ASSET_CODE, Issuer: TFT_ISSUER}
+	sourceAsset, err := parseAsset(pathPaymentSourceAsset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --path-payment-source %q: %w", pathPaymentSourceAsset, err)
+	}
+
+	pathsReq := horizonclient.PathsRequest{
+		DestinationAccount:     target,
+		DestinationAssetCode:   destAsset.Code,
+		DestinationAssetIssuer: destAsset.Issuer,
+		DestinationAssetType:   "credit_alphanum4",
+		DestinationAmount:      amount,
+		SourceAssets:           pathPaymentSourceAsset,
+	}
+	paths, err := cl.StrictReceivePaths(pathsReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover payment path for %s: %w", target, err)
+	}
+	if len(paths.Embedded.Records) == 0 {
+		return nil, fmt.Errorf("no payment path found from %s to TFT for %s", pathPaymentSourceAsset, target)
+	}
+	best := paths.Embedded.Records[0]
+
+	// Signers in the chunk0-1 multisig flow can take hours or days to
+	// collect, so the exact quoted price will likely have moved by
+	// submission time. Pad SendMax by --path-payment-slippage-bps so the
+	// path payment still clears instead of failing outright on
+	// PATH_PAYMENT_STRICT_RECEIVE_TOO_FEW_OFFERS-style price drift.
+	sendMax, err := applySlippage(best.SourceAmount, pathPaymentSlippageBps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply slippage to path payment for %s: %w", target, err)
+	}
+
+	path := make([]txnbuild.Asset, 0, len(best.Path))
+	for _, asset := range best.Path {
+		path = append(path, assetFromHorizonAsset(asset.Type, asset.Code, asset.Issuer))
+	}
+
+	return &txnbuild.PathPaymentStrictReceive{
+		SendAsset:     sourceAsset,
+		SendMax:       sendMax,
+		Destination:   target,
+		DestAsset:     destAsset,
+		DestAmount:    amount,
+		Path:          path,
+		SourceAccount: TFT_ISSUER,
+	}, nil
+}
+
+// applySlippage pads a quoted amount by bps basis points, e.g. bps=50 adds
+// 0.5%. Amounts are plain decimal strings with up to 7 fractional digits
+// everywhere else in this tool, so round-trip through a fixed-point stroop
+// count rather than a float to avoid accumulating rounding error.
+func applySlippage(amount string, bps int64) (string, error) {
+	stroops, err := amountToStroops(amount)
+	if err != nil {
+		return "", fmt.Errorf("invalid amount %q: %w", amount, err)
+	}
+
+	stroops += stroops * bps / 10_000
+
+	return stroopsToAmount(stroops), nil
+}
+
+func amountToStroops(amount string) (int64, error) {
+	parts := strings.SplitN(amount, ".", 2)
+	whole, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	var fraction int64
+	if len(parts) == 2 {
+		fracStr := parts[1]
+		for len(fracStr) < 7 {
+			fracStr += "0"
+		}
+		fraction, err = strconv.ParseInt(fracStr[:7], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return whole*10_000_000 + fraction, nil
+}
+
+func stroopsToAmount(stroops int64) string {
+	return fmt.Sprintf("%d.%07d", stroops/10_000_000, stroops%10_000_000)
+}
+
+// parseAsset accepts "native" for XLM or "CODE:ISSUER" for a credit asset,
+// the same shorthand Horizon itself uses in its path-finding endpoints.
+func parseAsset(spec string) (txnbuild.Asset, error) {
+	if spec == "" || spec == "native" {
+		return txnbuild.NativeAsset{}, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected \"native\" or \"CODE:ISSUER\", got %q", spec)
+	}
+	return txnbuild.CreditAsset{Code: parts[0], Issuer: parts[1]}, nil
+}
+
+func assetFromHorizonAsset(assetType, code, issuer string) txnbuild.Asset {
+	if assetType == "native" {
+		return txnbuild.NativeAsset{}
+	}
+	return txnbuild.CreditAsset{Code: code, Issuer: issuer}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+)
+
+// buildPreconditions assembles the full CAP-21 precondition set from the
+// --min-seq-age, --min-seq-ledger-gap, --ledger-bounds-min/max,
+// --min-seq-number and --extra-signer flags, on top of the TimeBounds the
+// tool has always set. Zero-valued flags are left unset rather than sent
+// as an explicit zero, since e.g. LedgerBounds{0, 0} is not the same as no
+// ledger bounds at all.
+func buildPreconditions() (txnbuild.Preconditions, error) {
+	preconditions := txnbuild.Preconditions{
+		TimeBounds:                 txnbuild.NewTimeout(TXN_VALIDITY_TIME_SECONDS),
+		MinSequenceNumberAge:       uint64(minSeqAge),
+		MinSequenceNumberLedgerGap: uint32(minSeqLedgerGap),
+	}
+
+	if minSeqNumber != 0 {
+		preconditions.MinSequenceNumber = &minSeqNumber
+	}
+
+	if ledgerBoundsMin != 0 || ledgerBoundsMax != 0 {
+		preconditions.LedgerBounds = &txnbuild.LedgerBounds{
+			MinLedger: uint32(ledgerBoundsMin),
+			MaxLedger: uint32(ledgerBoundsMax),
+		}
+	}
+
+	for _, address := range extraSigners {
+		kp, err := keypair.ParseAddress(address)
+		if err != nil {
+			return txnbuild.Preconditions{}, fmt.Errorf("invalid --extra-signer %q: %w", address, err)
+		}
+		preconditions.ExtraSigners = append(preconditions.ExtraSigners, kp.Address())
+	}
+
+	return preconditions, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizonclient"
+)
+
+const (
+	SUBMIT_MAX_RETRIES  = 5
+	SUBMIT_RETRY_BASE   = 2 * time.Second
+	SUBMIT_RETRY_FACTOR = 2
+)
+
+// payoutResult is one row of the run report, and also the unit persisted to
+// the resumable state file so an interrupted run can pick up where it left
+// off without resubmitting transactions that already made it to Horizon.
+type payoutResult struct {
+	Index      int    `json:"index"`
+	Hash       string `json:"hash"`
+	Ledger     int32  `json:"ledger,omitempty"`
+	ResultCode string `json:"result_code"`
+	Extras     string `json:"extras,omitempty"`
+	Done       bool   `json:"done"`
+}
+
+func runSubmit(args []string) {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	inputFile := fs.String("inputfile", "payouts_signed_combined.txt", "The file containing fully-signed transaction envelopes")
+	stateFile := fs.String("statefile", "payouts_submit_state.json", "File used to track submission progress so a run can be safely resumed")
+	reportFile := fs.String("reportfile", "payouts_submit_report.csv", "Where to write the per-payout run report")
+	concurrency := fs.Int("concurrency", 4, "Number of transactions to submit concurrently")
+	fs.Parse(args)
+
+	if *concurrency < 1 {
+		panic(fmt.Sprintf("--concurrency must be at least 1, got %d", *concurrency))
+	}
+
+	cl := horizonclient.DefaultPublicNetClient
+
+	lines, err := readLines(*inputFile)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read input file %s", err))
+	}
+
+	state, err := loadSubmitState(*stateFile, len(lines))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load submission state %s", err))
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, *concurrency)
+		pending = 0
+	)
+
+	for i, line := range lines {
+		if state[i].Done {
+			continue
+		}
+		pending++
+
+		i, line := i, line
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := submitWithRetry(cl, i, line)
+
+			mu.Lock()
+			state[i] = result
+			saveSubmitState(*stateFile, state)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if err := writeSubmitReport(*reportFile, state); err != nil {
+		panic(fmt.Sprintf("Failed to write run report %s", err))
+	}
+
+	fmt.Println("Submitted", pending, "transactions,", len(lines), "total in run")
+}
+
+// submitWithRetry posts a single transaction, retrying on 504s and timeouts
+// with exponential backoff. tx_bad_seq is not retried here: the envelope's
+// signatures cover its sequence number, so making it valid again requires
+// re-signing with a fresh sequence, and submit has no signer keys to do
+// that itself (submit only ever sees the fully-signed output of the
+// chunk0-1 sign/combine flow). Those rows are reported as
+// tx_bad_seq_needs_resign and left un-done, so a re-signed replacement can
+// be resubmitted later by rerunning the earlier pipeline stages.
+func submitWithRetry(cl *horizonclient.Client, index int, envelope string) payoutResult {
+	backoff := SUBMIT_RETRY_BASE
+
+	for attempt := 0; attempt <= SUBMIT_MAX_RETRIES; attempt++ {
+		resp, err := cl.SubmitTransactionXDR(envelope)
+		if err == nil {
+			return payoutResult{
+				Index:      index,
+				Hash:       resp.Hash,
+				Ledger:     int32(resp.Ledger),
+				ResultCode: "tx_success",
+				Done:       true,
+			}
+		}
+
+		hErr, ok := err.(*horizonclient.Error)
+		if !ok {
+			return payoutResult{Index: index, ResultCode: "error", Extras: err.Error(), Done: true}
+		}
+
+		codes, _ := hErr.ResultCodes()
+		if codes != nil && codes.TransactionCode == "tx_bad_seq" {
+			return payoutResult{Index: index, ResultCode: "tx_bad_seq_needs_resign", Done: false}
+		}
+
+		if hErr.Response.StatusCode == 504 || strings.Contains(hErr.Problem.Title, "Timeout") {
+			time.Sleep(backoff)
+			backoff *= SUBMIT_RETRY_FACTOR
+			continue
+		}
+
+		extras := ""
+		if codes != nil {
+			extras = fmt.Sprintf("%+v", codes)
+		}
+		return payoutResult{Index: index, ResultCode: "tx_failed", Extras: extras, Done: true}
+	}
+
+	return payoutResult{Index: index, ResultCode: "tx_retries_exhausted", Done: false}
+}
+
+func loadSubmitState(path string, n int) ([]payoutResult, error) {
+	state := make([]payoutResult, n)
+	for i := range state {
+		state[i].Index = i
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var saved []payoutResult
+	if err := json.NewDecoder(f).Decode(&saved); err != nil {
+		if errors.Is(err, io.EOF) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	for _, r := range saved {
+		if r.Index >= 0 && r.Index < n {
+			state[r.Index] = r
+		}
+	}
+	return state, nil
+}
+
+func saveSubmitState(path string, state []payoutResult) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		fmt.Println("WARNING: failed to persist submission state", err)
+		return
+	}
+
+	if err := json.NewEncoder(f).Encode(state); err != nil {
+		fmt.Println("WARNING: failed to encode submission state", err)
+		f.Close()
+		return
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, path); err != nil {
+		fmt.Println("WARNING: failed to finalize submission state", err)
+	}
+}
+
+func writeSubmitReport(path string, state []payoutResult) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	w.WriteString("index,hash,ledger,result_code,extras\n")
+	for _, r := range state {
+		fmt.Fprintf(w, "%d,%s,%d,%s,%q\n", r.Index, r.Hash, r.Ledger, r.ResultCode, r.Extras)
+	}
+	return nil
+}